@@ -1,8 +1,9 @@
 package image
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"runtime"
 
 	"github.com/containers/image/types"
@@ -29,24 +30,87 @@ type manifestList struct {
 	Manifests     []manifestDescriptor `json:"manifests"`
 }
 
-func manifestSchema2FromManifestList(src types.ImageSource, manblob []byte) (genericManifest, error) {
+// platformMatches returns true if candidate satisfies the platform requested via wantedArch/wantedOS
+// and includes at least all of requiredOSFeatures/requiredFeatures.
+func platformMatches(candidate platformSpec, wantedArch, wantedOS string, requiredOSFeatures, requiredFeatures []string) bool {
+	if candidate.Architecture != wantedArch || candidate.OS != wantedOS {
+		return false
+	}
+	return stringSliceContainsAll(candidate.OSFeatures, requiredOSFeatures) && stringSliceContainsAll(candidate.Features, requiredFeatures)
+}
+
+// stringSliceContainsAll returns true if every element of want is present in have.
+func stringSliceContainsAll(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// manifestSchema2FromManifestList parses a blob as a schema2 manifest list or an OCI image index,
+// and returns the manifest for the platform most appropriate to sys (or the current platform,
+// if sys is nil or leaves the relevant fields empty).
+func manifestSchema2FromManifestList(ctx context.Context, sys *types.SystemContext, src types.ImageSource, manblob []byte) (genericManifest, error) {
 	list := manifestList{}
 	if err := json.Unmarshal(manblob, &list); err != nil {
 		return nil, err
 	}
-	var targetManifestDigest string
-	for _, d := range list.Manifests {
-		if d.Platform.Architecture == runtime.GOARCH && d.Platform.OS == runtime.GOOS {
-			targetManifestDigest = d.Digest
+
+	wantedArch := runtime.GOARCH
+	wantedOS := runtime.GOOS
+	wantedVariant := ""
+	var requiredOSFeatures, requiredFeatures []string
+	if sys != nil {
+		if sys.ArchitectureChoice != "" {
+			wantedArch = sys.ArchitectureChoice
+		}
+		if sys.OSChoice != "" {
+			wantedOS = sys.OSChoice
+		}
+		wantedVariant = sys.VariantChoice
+		requiredOSFeatures = sys.RequiredOSFeatures
+		requiredFeatures = sys.RequiredFeatures
+	}
+
+	// Prefer an entry whose architecture+os+variant all match; fall back to an arch+os match
+	// with no variant preference only if no variant-exact match exists.
+	var exactVariantMatch, archOSMatch *manifestDescriptor
+	for i, d := range list.Manifests {
+		if !platformMatches(d.Platform, wantedArch, wantedOS, requiredOSFeatures, requiredFeatures) {
+			continue
+		}
+		if archOSMatch == nil {
+			archOSMatch = &list.Manifests[i]
+		}
+		if d.Platform.Variant == wantedVariant {
+			exactVariantMatch = &list.Manifests[i]
 			break
 		}
 	}
-	if targetManifestDigest == "" {
-		return nil, errors.New("no supported platform found in manifest list")
+	target := exactVariantMatch
+	if target == nil {
+		target = archOSMatch
+	}
+	if target == nil {
+		available := make([]string, 0, len(list.Manifests))
+		for _, d := range list.Manifests {
+			available = append(available, fmt.Sprintf("(%s, %s, %s)", d.Platform.OS, d.Platform.Architecture, d.Platform.Variant))
+		}
+		return nil, fmt.Errorf("no image found for requested platform (%s, %s, %s) in manifest list; available: %v", wantedOS, wantedArch, wantedVariant, available)
 	}
-	manblob, mt, err := src.GetTargetManifest(targetManifestDigest)
+
+	manblob, mt, err := src.GetTargetManifest(ctx, target.Digest)
 	if err != nil {
 		return nil, err
 	}
-	return manifestInstanceFromBlob(src, manblob, mt)
+	return manifestInstanceFromBlob(ctx, sys, src, manblob, mt)
 }
@@ -0,0 +1,136 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/containers/image/manifest"
+	"github.com/containers/image/pkg/compression"
+	"github.com/containers/image/types"
+)
+
+// schema1V1Compatibility is the per-layer metadata embedded as a JSON string in a schema1 manifest's
+// history entries; only the fields needed to synthesize an OCI config are represented here.
+type schema1V1Compatibility struct {
+	Created         time.Time       `json:"created"`
+	Author          string          `json:"author,omitempty"`
+	Architecture    string          `json:"architecture,omitempty"`
+	OS              string          `json:"os,omitempty"`
+	ThrowAway       bool            `json:"throwaway,omitempty"`
+	ContainerConfig json.RawMessage `json:"container_config,omitempty"`
+	Config          json.RawMessage `json:"config,omitempty"`
+}
+
+type schema1Manifest struct {
+	FSLayers []schema1FSLayer      `json:"fsLayers"`
+	History  []schema1HistoryEntry `json:"history"`
+}
+type schema1FSLayer struct {
+	BlobSum string `json:"blobSum"`
+}
+type schema1HistoryEntry struct {
+	V1Compatibility string `json:"v1Compatibility"`
+}
+
+// OCIConfig returns src's image configuration as an OCI v1.Image, synthesizing one out of a schema1
+// manifest's embedded v1Compatibility history if necessary, so that callers which need a v1.Image
+// (the same way cri-o's runtimeService.createContainerOrPodSandbox does) can rely on a single entry
+// point regardless of whether src is schema1 or schema2/OCI.
+func OCIConfig(ctx context.Context, src types.ImageSource) (*imgspecv1.Image, error) {
+	configBlob, mimeType, err := src.GetConfigBlob(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch mimeType {
+	case manifest.DockerV2Schema1MediaType, manifest.DockerV2Schema1SignedMediaType:
+		return schema1OCIConfig(ctx, src, configBlob)
+	default:
+		ociConfig := imgspecv1.Image{}
+		if err := json.Unmarshal(configBlob, &ociConfig); err != nil {
+			return nil, err
+		}
+		return &ociConfig, nil
+	}
+}
+
+// schema1OCIConfig converts a schema1 manifest blob's embedded v1Compatibility history into a
+// synthesized OCI v1.Image, fetching the layer blobs from src to compute real DiffIDs.
+func schema1OCIConfig(ctx context.Context, src types.ImageSource, manifestBlob []byte) (*imgspecv1.Image, error) {
+	var m schema1Manifest
+	if err := json.Unmarshal(manifestBlob, &m); err != nil {
+		return nil, err
+	}
+	if len(m.History) == 0 {
+		return nil, fmt.Errorf("schema1 manifest has no history entries to synthesize a config from")
+	}
+	var v1c schema1V1Compatibility
+	if err := json.Unmarshal([]byte(m.History[0].V1Compatibility), &v1c); err != nil {
+		return nil, err
+	}
+	config := v1c.Config
+	if len(config) == 0 {
+		config = v1c.ContainerConfig
+	}
+	var ociConfig imgspecv1.ImageConfig
+	if len(config) != 0 {
+		if err := json.Unmarshal(config, &ociConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	// schema1 fsLayers/history are parallel arrays listed child-to-parent, one entry per layer
+	// (including throwaway/empty layers, which must be excluded from an OCI config's RootFS);
+	// RootFS.DiffIDs must be ordered parent-to-child, and must be digests of the *uncompressed*
+	// layer contents.
+	if len(m.FSLayers) != len(m.History) {
+		return nil, fmt.Errorf("schema1 manifest has %d fsLayers but %d history entries", len(m.FSLayers), len(m.History))
+	}
+	diffIDs := []digest.Digest{}
+	for i := len(m.History) - 1; i >= 0; i-- {
+		var hv1c schema1V1Compatibility
+		if err := json.Unmarshal([]byte(m.History[i].V1Compatibility), &hv1c); err != nil {
+			return nil, err
+		}
+		if hv1c.ThrowAway {
+			continue
+		}
+		diffID, err := diffIDOfBlob(ctx, src, digest.Digest(m.FSLayers[i].BlobSum))
+		if err != nil {
+			return nil, fmt.Errorf("computing DiffID of layer %s: %v", m.FSLayers[i].BlobSum, err)
+		}
+		diffIDs = append(diffIDs, diffID)
+	}
+
+	return &imgspecv1.Image{
+		Created:      &v1c.Created,
+		Author:       v1c.Author,
+		Architecture: v1c.Architecture,
+		OS:           v1c.OS,
+		Config:       ociConfig,
+		RootFS: imgspecv1.RootFS{
+			Type:    "layers",
+			DiffIDs: diffIDs,
+		},
+	}, nil
+}
+
+// diffIDOfBlob fetches the layer identified by blobDigest from src and returns the digest of its
+// decompressed contents, as required for an OCI config's RootFS.DiffIDs.
+func diffIDOfBlob(ctx context.Context, src types.ImageSource, blobDigest digest.Digest) (digest.Digest, error) {
+	rc, _, err := src.GetBlob(ctx, string(blobDigest))
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	stream, err := compression.DecompressStream(rc)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+	return digest.Canonical.FromReader(stream)
+}
@@ -2,6 +2,7 @@ package openshift
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
@@ -68,7 +69,15 @@ func newOpenshiftClient(ref openshiftReference) (*openshiftClient, error) {
 }
 
 // doRequest performs a correctly authenticated request to a specified path, and returns response body or an error object.
-func (c *openshiftClient) doRequest(method, path string, requestBody []byte) ([]byte, error) {
+func (c *openshiftClient) doRequest(ctx context.Context, method, path string, requestBody []byte) ([]byte, error) {
+	body, _, err := c.doRawRequest(ctx, method, path, requestBody)
+	return body, err
+}
+
+// doRawRequest is like doRequest, but also returns the HTTP status code of the response, so that
+// callers which need to tolerate specific failure status codes (e.g. a 404 on a best-effort DELETE)
+// don't have to parse them back out of the error.
+func (c *openshiftClient) doRawRequest(ctx context.Context, method, path string, requestBody []byte) ([]byte, int, error) {
 	url := *c.baseURL
 	url.Path = path
 	var requestBodyReader io.Reader
@@ -76,9 +85,9 @@ func (c *openshiftClient) doRequest(method, path string, requestBody []byte) ([]
 		logrus.Debugf("Will send body: %s", requestBody)
 		requestBodyReader = bytes.NewReader(requestBody)
 	}
-	req, err := http.NewRequest(method, url.String(), requestBodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, url.String(), requestBodyReader)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if len(c.bearerToken) != 0 {
@@ -95,12 +104,12 @@ func (c *openshiftClient) doRequest(method, path string, requestBody []byte) ([]
 	logrus.Debugf("%s %s", method, url)
 	res, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer res.Body.Close()
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	logrus.Debugf("Got body: %s", body)
 	// FIXME: Just throwing this useful information away only to try to guess later...
@@ -115,25 +124,25 @@ func (c *openshiftClient) doRequest(method, path string, requestBody []byte) ([]
 	switch {
 	case res.StatusCode == http.StatusSwitchingProtocols: // FIXME?! No idea why this weird case exists in k8s.io/kubernetes/pkg/client/restclient.
 		if statusValid && status.Status != "Success" {
-			return nil, errors.New(status.Message)
+			return nil, res.StatusCode, errors.New(status.Message)
 		}
 	case res.StatusCode >= http.StatusOK && res.StatusCode <= http.StatusPartialContent:
 		// OK.
 	default:
 		if statusValid {
-			return nil, errors.New(status.Message)
+			return nil, res.StatusCode, errors.New(status.Message)
 		}
-		return nil, fmt.Errorf("HTTP error: status code: %d, body: %s", res.StatusCode, string(body))
+		return nil, res.StatusCode, fmt.Errorf("HTTP error: status code: %d, body: %s", res.StatusCode, string(body))
 	}
 
-	return body, nil
+	return body, res.StatusCode, nil
 }
 
 // getImage loads the specified image object.
-func (c *openshiftClient) getImage(imageStreamImageName string) (*image, error) {
+func (c *openshiftClient) getImage(ctx context.Context, imageStreamImageName string) (*image, error) {
 	// FIXME: validate components per validation.IsValidPathSegmentName?
 	path := fmt.Sprintf("/oapi/v1/namespaces/%s/imagestreamimages/%s@%s", c.ref.namespace, c.ref.stream, imageStreamImageName)
-	body, err := c.doRequest("GET", path, nil)
+	body, err := c.doRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -158,7 +167,7 @@ func (c *openshiftClient) convertDockerImageReference(ref string) (string, error
 type openshiftImageSource struct {
 	client *openshiftClient
 	// Values specific to this image
-	ctx                        *types.SystemContext
+	sys                        *types.SystemContext
 	requestedManifestMIMETypes []string
 	// State
 	docker               types.ImageSource // The Docker Registry endpoint, or nil if not resolved yet
@@ -169,15 +178,15 @@ type openshiftImageSource struct {
 // asking the backend to use a manifest from requestedManifestMIMETypes if possible.
 // nil requestedManifestMIMETypes means manifest.DefaultRequestedManifestMIMETypes.
 // The caller must call .Close() on the returned ImageSource.
-func newImageSource(ctx *types.SystemContext, ref openshiftReference, requestedManifestMIMETypes []string) (types.ImageSource, error) {
+func newImageSource(ctx context.Context, sys *types.SystemContext, ref openshiftReference, requestedManifestMIMETypes []string) (types.ImageSource, error) {
 	client, err := newOpenshiftClient(ref)
 	if err != nil {
 		return nil, err
 	}
 
 	return &openshiftImageSource{
-		client: client,
-		ctx:    ctx,
+		client:                     client,
+		sys:                        sys,
 		requestedManifestMIMETypes: requestedManifestMIMETypes,
 	}, nil
 }
@@ -196,34 +205,80 @@ func (s *openshiftImageSource) Close() {
 	}
 }
 
-func (s *openshiftImageSource) GetTargetManifest(digest string) ([]byte, string, error) {
-	if err := s.ensureImageIsResolved(); err != nil {
+func (s *openshiftImageSource) GetTargetManifest(ctx context.Context, digest string) ([]byte, string, error) {
+	if err := s.ensureImageIsResolved(ctx); err != nil {
 		return nil, "", err
 	}
-	return s.docker.GetTargetManifest(digest)
+	return s.docker.GetTargetManifest(ctx, digest)
 }
 
-func (s *openshiftImageSource) GetManifest() ([]byte, string, error) {
-	if err := s.ensureImageIsResolved(); err != nil {
+func (s *openshiftImageSource) GetManifest(ctx context.Context) ([]byte, string, error) {
+	if err := s.ensureImageIsResolved(ctx); err != nil {
 		return nil, "", err
 	}
-	return s.docker.GetManifest()
+	return s.docker.GetManifest(ctx)
 }
 
 // GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
-func (s *openshiftImageSource) GetBlob(digest string) (io.ReadCloser, int64, error) {
-	if err := s.ensureImageIsResolved(); err != nil {
+func (s *openshiftImageSource) GetBlob(ctx context.Context, digest string) (io.ReadCloser, int64, error) {
+	if err := s.ensureImageIsResolved(ctx); err != nil {
 		return nil, 0, err
 	}
-	return s.docker.GetBlob(digest)
+	return s.docker.GetBlob(ctx, digest)
+}
+
+// GetConfigBlob returns the image's configuration JSON and its media type, without requiring the
+// caller to pull any layers. For schema2/OCI images it reads the config digest out of the Image object
+// (loaded via getImage for the digest resolved by ensureImageIsResolved) and fetches it from the Docker Registry endpoint;
+// schema1 images carry no separate config blob, so the Image object's embedded DockerImageManifest
+// (the schema1 manifest itself, fsLayers/history and all) is returned as-is, for image.OCIConfig to
+// synthesize a config from.
+func (s *openshiftImageSource) GetConfigBlob(ctx context.Context) ([]byte, string, error) {
+	if err := s.ensureImageIsResolved(ctx); err != nil {
+		return nil, "", err
+	}
+	image, err := s.client.getImage(ctx, s.imageStreamImageName)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(image.DockerImageManifest) == 0 {
+		return nil, "", fmt.Errorf("image %s has no dockerImageManifest", s.imageStreamImageName)
+	}
+	var probe manifestSchema2ConfigProbe
+	if err := json.Unmarshal([]byte(image.DockerImageManifest), &probe); err != nil {
+		return nil, "", err
+	}
+	switch {
+	case probe.SchemaVersion == 2 && probe.Config.Digest != "":
+		rc, _, err := s.docker.GetBlob(ctx, probe.Config.Digest)
+		if err != nil {
+			return nil, "", err
+		}
+		defer rc.Close()
+		config, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return nil, "", err
+		}
+		// Key off the config descriptor's own (mandatory) mediaType rather than the manifest's
+		// top-level mediaType, which OCI makes optional and may be absent.
+		configMediaType := probe.Config.MediaType
+		if configMediaType == "" {
+			configMediaType = dockerV2Schema2ConfigMediaType
+		}
+		return config, configMediaType, nil
+	case probe.SchemaVersion == 1:
+		return []byte(image.DockerImageManifest), manifest.DockerV2Schema1MediaType, nil
+	default:
+		return nil, "", fmt.Errorf("image %s has a dockerImageManifest with unrecognized schemaVersion %d", s.imageStreamImageName, probe.SchemaVersion)
+	}
 }
 
-func (s *openshiftImageSource) GetSignatures() ([][]byte, error) {
-	if err := s.ensureImageIsResolved(); err != nil {
+func (s *openshiftImageSource) GetSignatures(ctx context.Context) ([][]byte, error) {
+	if err := s.ensureImageIsResolved(ctx); err != nil {
 		return nil, err
 	}
 
-	image, err := s.client.getImage(s.imageStreamImageName)
+	image, err := s.client.getImage(ctx, s.imageStreamImageName)
 	if err != nil {
 		return nil, err
 	}
@@ -237,14 +292,14 @@ func (s *openshiftImageSource) GetSignatures() ([][]byte, error) {
 }
 
 // ensureImageIsResolved sets up s.docker and s.imageStreamImageName
-func (s *openshiftImageSource) ensureImageIsResolved() error {
+func (s *openshiftImageSource) ensureImageIsResolved(ctx context.Context) error {
 	if s.docker != nil {
 		return nil
 	}
 
 	// FIXME: validate components per validation.IsValidPathSegmentName?
 	path := fmt.Sprintf("/oapi/v1/namespaces/%s/imagestreams/%s", s.client.ref.namespace, s.client.ref.stream)
-	body, err := s.client.doRequest("GET", path, nil)
+	body, err := s.client.doRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return err
 	}
@@ -276,7 +331,7 @@ func (s *openshiftImageSource) ensureImageIsResolved() error {
 	if err != nil {
 		return err
 	}
-	d, err := dockerRef.NewImageSource(s.ctx, s.requestedManifestMIMETypes)
+	d, err := dockerRef.NewImageSource(ctx, s.sys, s.requestedManifestMIMETypes)
 	if err != nil {
 		return err
 	}
@@ -288,12 +343,13 @@ func (s *openshiftImageSource) ensureImageIsResolved() error {
 type openshiftImageDestination struct {
 	client *openshiftClient
 	docker types.ImageDestination // The Docker Registry endpoint
+	sys    *types.SystemContext
 	// State
 	imageStreamImageName string // "" if not yet known
 }
 
 // newImageDestination creates a new ImageDestination for the specified reference.
-func newImageDestination(ctx *types.SystemContext, ref openshiftReference) (types.ImageDestination, error) {
+func newImageDestination(ctx context.Context, sys *types.SystemContext, ref openshiftReference) (types.ImageDestination, error) {
 	client, err := newOpenshiftClient(ref)
 	if err != nil {
 		return nil, err
@@ -307,7 +363,7 @@ func newImageDestination(ctx *types.SystemContext, ref openshiftReference) (type
 	if err != nil {
 		return nil, err
 	}
-	docker, err := dockerRef.NewImageDestination(ctx)
+	docker, err := dockerRef.NewImageDestination(ctx, sys)
 	if err != nil {
 		return nil, err
 	}
@@ -315,6 +371,7 @@ func newImageDestination(ctx *types.SystemContext, ref openshiftReference) (type
 	return &openshiftImageDestination{
 		client: client,
 		docker: docker,
+		sys:    sys,
 	}, nil
 }
 
@@ -353,32 +410,36 @@ func (d *openshiftImageDestination) ShouldCompressLayers() bool {
 // WARNING: The contents of stream are being verified on the fly.  Until stream.Read() returns io.EOF, the contents of the data SHOULD NOT be available
 // to any other readers for download using the supplied digest.
 // If stream.Read() at any time, ESPECIALLY at end of input, returns an error, PutBlob MUST 1) fail, and 2) delete any data stored so far.
-func (d *openshiftImageDestination) PutBlob(stream io.Reader, inputInfo types.BlobInfo) (types.BlobInfo, error) {
-	return d.docker.PutBlob(stream, inputInfo)
+func (d *openshiftImageDestination) PutBlob(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo) (types.BlobInfo, error) {
+	return d.docker.PutBlob(ctx, stream, inputInfo)
 }
 
-func (d *openshiftImageDestination) PutManifest(m []byte) error {
+func (d *openshiftImageDestination) PutManifest(ctx context.Context, m []byte) error {
 	manifestDigest, err := manifest.Digest(m)
 	if err != nil {
 		return err
 	}
 	d.imageStreamImageName = manifestDigest
 
-	return d.docker.PutManifest(m)
+	return d.docker.PutManifest(ctx, m)
 }
 
-func (d *openshiftImageDestination) PutSignatures(signatures [][]byte) error {
+// PutSignatures records the desired set of signatures for the image identified by d.imageStreamImageName.
+// Because image signatures are a shared resource in Atomic Registry, the default upload only adds
+// new signatures; if sys.OpenShiftSignatureReconcile is set, it also removes atomic signatures attached
+// to the image that are not included in signatures, so that skopeo copy --remove-signatures and
+// signature re-keying can reconcile the full desired set, not just add to it. Non-atomic signature
+// types (e.g. from a third-party signature controller) are never touched.
+func (d *openshiftImageDestination) PutSignatures(ctx context.Context, signatures [][]byte) error {
 	if d.imageStreamImageName == "" {
 		return fmt.Errorf("Internal error: Unknown manifest digest, can't add signatures")
 	}
-	// Because image signatures are a shared resource in Atomic Registry, the default upload
-	// always adds signatures.  Eventually we should also allow removing signatures.
-
-	if len(signatures) == 0 {
+	reconcile := d.sys != nil && d.sys.OpenShiftSignatureReconcile
+	if len(signatures) == 0 && !reconcile {
 		return nil // No need to even read the old state.
 	}
 
-	image, err := d.client.getImage(d.imageStreamImageName)
+	image, err := d.client.getImage(ctx, d.imageStreamImageName)
 	if err != nil {
 		return err
 	}
@@ -419,12 +480,43 @@ sigExists:
 			Content:    newSig,
 		}
 		body, err := json.Marshal(sig)
-		_, err = d.client.doRequest("POST", "/oapi/v1/imagesignatures", body)
+		_, err = d.client.doRequest(ctx, "POST", "/oapi/v1/imagesignatures", body)
 		if err != nil {
 			return err
 		}
 	}
 
+	if reconcile {
+		if err := d.deleteUnwantedSignatures(ctx, image, signatures); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteUnwantedSignatures deletes atomic signatures attached to image that are not present in desired.
+func (d *openshiftImageDestination) deleteUnwantedSignatures(ctx context.Context, image *image, desired [][]byte) error {
+	for _, existingSig := range image.Signatures {
+		if existingSig.Type != imageSignatureTypeAtomic {
+			continue // Leave third-party signature controllers' signatures alone.
+		}
+		wanted := false
+		for _, sig := range desired {
+			if bytes.Equal(existingSig.Content, sig) {
+				wanted = true
+				break
+			}
+		}
+		if wanted {
+			continue
+		}
+		path := fmt.Sprintf("/oapi/v1/imagesignatures/%s", existingSig.objectMeta.Name)
+		if _, status, err := d.client.doRawRequest(ctx, "DELETE", path, nil); err != nil && status != http.StatusNotFound {
+			// A 404 means another client already deleted it; anything else is a real error.
+			return err
+		}
+	}
 	return nil
 }
 
@@ -432,8 +524,65 @@ sigExists:
 // WARNING: This does not have any transactional semantics:
 // - Uploaded data MAY be visible to others before Commit() is called
 // - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
-func (d *openshiftImageDestination) Commit() error {
-	return d.docker.Commit()
+func (d *openshiftImageDestination) Commit(ctx context.Context) error {
+	if err := d.docker.Commit(ctx); err != nil {
+		return err
+	}
+	return d.importTag(ctx)
+}
+
+// importTag asks the OpenShift API to materialize the tag d.client.ref refers to in the
+// image stream, pointing it at the manifest just pushed to the integrated registry via d.docker.
+// Unlike pushing straight to the registry, this does not require the tag to already exist, and it
+// surfaces OpenShift-side errors (quota, image policy, missing pull secret) instead of failing silently.
+func (d *openshiftImageDestination) importTag(ctx context.Context) error {
+	if d.imageStreamImageName == "" {
+		return fmt.Errorf("Internal error: Unknown manifest digest, can't import image")
+	}
+	dockerImageReference := fmt.Sprintf("%s/%s/%s@%s", d.client.ref.dockerReference.Hostname(), d.client.ref.namespace, d.client.ref.stream, d.imageStreamImageName)
+	isi := imageStreamImport{
+		typeMeta: typeMeta{
+			Kind:       "ImageStreamImport",
+			APIVersion: "image.openshift.io/v1",
+		},
+		objectMeta: objectMeta{
+			Namespace: d.client.ref.namespace,
+			Name:      d.client.ref.stream,
+		},
+		Spec: imageStreamImportSpec{
+			Import: true,
+			Images: []imageImportSpec{
+				{
+					From: objectReference{Kind: "DockerImage", Name: dockerImageReference},
+					To:   &objectReference{Name: d.client.ref.dockerReference.Tag()},
+				},
+			},
+		},
+	}
+	body, err := json.Marshal(isi)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/oapi/v1/namespaces/%s/imagestreamimports", d.client.ref.namespace)
+	respBody, err := d.client.doRequest(ctx, "POST", path, body)
+	if err != nil {
+		return err
+	}
+	// Note: This does absolutely no kind/version checking or conversions.
+	var isiResponse imageStreamImport
+	if err := json.Unmarshal(respBody, &isiResponse); err != nil {
+		return err
+	}
+	// The OpenShift API performs a direct (non-scheduled) import synchronously, so the result is
+	// already final by the time doRequest returns; there is nothing to poll for.
+	if len(isiResponse.Status.Images) != 1 {
+		return fmt.Errorf("Unexpected ImageStreamImport response: got %d image statuses, expected 1", len(isiResponse.Status.Images))
+	}
+	imageStatus := isiResponse.Status.Images[0]
+	if imageStatus.Status.Status != "Success" {
+		return fmt.Errorf("Error importing image: %s", imageStatus.Status.Message)
+	}
+	return nil
 }
 
 // These structs are subsets of github.com/openshift/origin/pkg/image/api/v1 and its dependencies.
@@ -455,16 +604,52 @@ type tagEvent struct {
 type imageStreamImage struct {
 	Image image `json:"image"`
 }
+type imageStreamImport struct {
+	typeMeta   `json:",inline"`
+	objectMeta `json:"metadata,omitempty"`
+	Spec       imageStreamImportSpec   `json:"spec"`
+	Status     imageStreamImportStatus `json:"status,omitempty"`
+}
+type imageStreamImportSpec struct {
+	Import bool              `json:"import"`
+	Images []imageImportSpec `json:"images,omitempty"`
+}
+type imageImportSpec struct {
+	From objectReference  `json:"from"`
+	To   *objectReference `json:"to,omitempty"`
+}
+type objectReference struct {
+	Kind string `json:"kind,omitempty"`
+	Name string `json:"name"`
+}
+type imageStreamImportStatus struct {
+	Images []imageImportStatus `json:"images,omitempty"`
+}
+type imageImportStatus struct {
+	Status status `json:"status,omitempty"`
+	Image  *image `json:"image,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+}
 type image struct {
 	objectMeta           `json:"metadata,omitempty"`
 	DockerImageReference string `json:"dockerImageReference,omitempty"`
-	//	DockerImageMetadata        runtime.RawExtension `json:"dockerImageMetadata,omitempty"`
-	DockerImageMetadataVersion string `json:"dockerImageMetadataVersion,omitempty"`
-	DockerImageManifest        string `json:"dockerImageManifest,omitempty"`
+	DockerImageManifest  string `json:"dockerImageManifest,omitempty"`
 	//	DockerImageLayers          []ImageLayer         `json:"dockerImageLayers"`
 	Signatures []imageSignature `json:"signatures,omitempty"`
 }
 
+// manifestSchema2ConfigProbe is the minimal subset of a schema2/OCI manifest needed to locate its config blob.
+type manifestSchema2ConfigProbe struct {
+	SchemaVersion int                      `json:"schemaVersion"`
+	Config        manifestConfigDescriptor `json:"config"`
+}
+type manifestConfigDescriptor struct {
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediaType,omitempty"`
+}
+
+const dockerV2Schema2ConfigMediaType = "application/vnd.docker.container.image.v1+json"
+
 const imageSignatureTypeAtomic string = "atomic"
 
 type imageSignature struct {